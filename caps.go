@@ -0,0 +1,69 @@
+package gotirc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// saslChunkSize is the maximum size, in bytes, of a single base64-encoded
+// AUTHENTICATE line, per the IRCv3 SASL specification.
+const saslChunkSize = 400
+
+// SASLMechanism is implemented by types that can perform IRCv3 SASL
+// authentication as part of capability negotiation.
+type SASLMechanism interface {
+	// Name returns the mechanism name as sent in "AUTHENTICATE <name>",
+	// e.g. "PLAIN" or "EXTERNAL".
+	Name() string
+	// Response returns the (unencoded) authentication payload to send in
+	// response to the server's "AUTHENTICATE +" challenge.
+	Response() []byte
+}
+
+// SASLPlain implements the SASL PLAIN mechanism
+type SASLPlain struct {
+	User string
+	Pass string
+}
+
+// Name returns "PLAIN"
+func (s SASLPlain) Name() string { return "PLAIN" }
+
+// Response returns the PLAIN authzid/authcid/passwd payload
+func (s SASLPlain) Response() []byte {
+	return []byte(fmt.Sprintf("%s\x00%s\x00%s", s.User, s.User, s.Pass))
+}
+
+// SASLExternal implements the SASL EXTERNAL mechanism, which authenticates
+// using credentials already established out-of-band (e.g. a client TLS
+// certificate) and carries an empty response payload.
+type SASLExternal struct{}
+
+// Name returns "EXTERNAL"
+func (s SASLExternal) Name() string { return "EXTERNAL" }
+
+// Response returns an empty payload
+func (s SASLExternal) Response() []byte { return []byte{} }
+
+// doCapNotify handles unsolicited "CAP * NEW"/"CAP * DEL" messages sent by
+// servers that support cap-notify after negotiation has completed.
+func (c *Client) doCapNotify(msg *Message) {
+	if len(msg.Params) < 3 {
+		return
+	}
+
+	switch msg.Params[1] {
+	case "NEW":
+		for _, entry := range strings.Fields(msg.Params[2]) {
+			name, value := entry, ""
+			if idx := strings.IndexByte(entry, '='); idx >= 0 {
+				name, value = entry[:idx], entry[idx+1:]
+			}
+			c.setCap(name, value, true)
+		}
+	case "DEL":
+		for _, name := range strings.Fields(msg.Params[2]) {
+			c.setCap(name, "", false)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package gotirc
 
 import (
 	"bufio"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
@@ -14,7 +16,9 @@ import (
 
 const sendBufferSize = 512
 
-var caps = []string{"membership", "commands", "tags"}
+// defaultCapabilities are requested when Options.Capabilities is unset, matching
+// gotirc's historical behavior of negotiating Twitch's three IRCv3 extensions.
+var defaultCapabilities = []string{"twitch.tv/membership", "twitch.tv/commands", "twitch.tv/tags"}
 
 // Options facilitates passing desired settings to a new Client
 type Options struct {
@@ -22,16 +26,41 @@ type Options struct {
 	Port     int
 	Host     string
 	Channels []string
+
+	// Capabilities lists the IRCv3 capabilities to request during CAP
+	// negotiation. Defaults to Twitch's membership/commands/tags caps.
+	Capabilities []string
+
+	// SASL, if set, performs SASL authentication as part of capability
+	// negotiation (requires the "sasl" capability to be advertised).
+	SASL SASLMechanism
+
+	// ReconnectPolicy controls the backoff used by Run. Any backoff field
+	// left unset falls back to DefaultReconnectPolicy(); other fields
+	// (e.g. MaxAttempts) are honored as given.
+	ReconnectPolicy ReconnectPolicy
+
+	// MaxChannelsPerConn caps how many channels a Pool will assign to a
+	// single underlying Client before spinning up another connection.
+	// Only meaningful when the Options are used to construct a Pool;
+	// defaults to 90.
+	MaxChannelsPerConn int
+
+	// Dialer controls how Connect establishes the underlying network
+	// connection. Defaults to a TCPDialer built from Host/Port.
+	Dialer Dialer
 }
 
 // Client holds state and context information to maintain a connection with a server
 type Client struct {
 	options Options
 
-	sendQueue   chan string
-	recvChannel chan Message
-	reader      *bufio.Reader
-	writer      *bufio.Writer
+	pongQueue    chan outboundMessage
+	cmdQueue     chan outboundMessage
+	privmsgQueue chan outboundMessage
+	recvChannel  chan Message
+	reader       *bufio.Reader
+	writer       *bufio.Writer
 
 	conn        net.Conn
 	readTimeout time.Duration
@@ -39,7 +68,20 @@ type Client struct {
 	connected   bool
 	doneChan    chan struct{}
 
+	capsMu sync.RWMutex
+	caps   map[string]string
+
+	joinedChannels sync.Map
+
+	rateLimitMu    sync.RWMutex
+	rateLimits     map[RateLimitKind]*tokenBucket
+	channelLimitMu sync.Mutex
+	channelLimits  map[string]*tokenBucket
+
 	callbackMu            sync.Mutex
+	connectCallbacks      []func()
+	disconnectCallbacks   []func(err error)
+	capCallbacks          []func(name string, enabled bool)
 	actionCallbacks       []func(channel string, tags map[string]string, msg string)
 	chatCallbacks         []func(channel string, tags map[string]string, msg string)
 	resubCallbacks        []func(channel string, tags map[string]string, msg string)
@@ -52,13 +94,38 @@ type Client struct {
 	joinCallbacks         []func(channel, username string)
 	partCallbacks         []func(channel, username string)
 	whisperCallbacks      []func(username string, tags map[string]string, msg string)
+
+	subEventCallbacks       []func(event SubEvent)
+	resubEventCallbacks     []func(event ResubEvent)
+	subGiftEventCallbacks   []func(event SubGiftEvent)
+	subMysteryGiftCallbacks []func(event SubMysteryGiftEvent)
+	cheerEventCallbacks     []func(event CheerEvent)
+	raidCallbacks           []func(event RaidEvent)
+	ritualCallbacks         []func(event RitualEvent)
+	bitsBadgeTierCallbacks  []func(event BitsBadgeTierEvent)
+	banCallbacks            []func(event BanEvent)
+	timeoutCallbacks        []func(event TimeoutEvent)
+	messageDeletedCallbacks []func(event MessageDeletedEvent)
+	hostCallbacks           []func(event HostEvent)
+
+	rawMessageCallbacks         []func(msg Message) (handled bool)
+	unhandledCallbacks          []func(msg Message)
+	globalUserStateCallbacks    []func(tags map[string]string)
+	reconnectRequestedCallbacks []func()
 }
 
 // NewClient returns a new Client
 func NewClient(o Options) *Client {
 	return &Client{
-		options:     o,
-		readTimeout: 10 * time.Minute,
+		options:       o,
+		readTimeout:   10 * time.Minute,
+		caps:          make(map[string]string),
+		channelLimits: make(map[string]*tokenBucket),
+		rateLimits: map[RateLimitKind]*tokenBucket{
+			RatePrivmsg: newTokenBucket(20, 30),
+			RateJoin:    newTokenBucket(20, 10),
+			RateWhisper: newTokenBucket(20, 30),
+		},
 	}
 }
 
@@ -66,15 +133,38 @@ func NewClient(o Options) *Client {
 // the supplied nick and pass (oauth token) to authenticate. Connect blocks and
 // runs event callbacks until disconnected
 func (c *Client) Connect(nick string, pass string) error {
+	return c.connect(context.Background(), nick, pass)
+}
+
+// connect is the context-aware implementation behind Connect, letting Run
+// thread its ctx all the way down into the Dialer so a cancelled context
+// interrupts an in-flight dial instead of only being noticed afterward.
+func (c *Client) connect(ctx context.Context, nick, pass string) error {
+	dialer := c.options.Dialer
+	if dialer == nil {
+		dialer = TCPDialer{Host: c.options.Host, Port: c.options.Port}
+	}
+
 	conn, err := c.doConnect(func() (net.Conn, error) {
-		return net.Dial("tcp", fmt.Sprintf("%s:%d", c.options.Host, c.options.Port))
+		return dialer.Dial(ctx)
 	})
 
 	if err != nil {
 		return err
 	}
 
-	return c.doPostConnect(nick, pass, conn, 19, 30)
+	// Closing conn once ctx is cancelled ends the handshake or recv loop, so
+	// Run returns promptly instead of waiting for the server to drop us.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	err = c.doPostConnect(nick, pass, conn)
+	// A failed handshake returns before the recv loop that would mark the
+	// client disconnected; without this every later connect would fail
+	// with "Already connected".
+	c.Disconnect()
+	conn.Close()
+	return err
 }
 
 func (c *Client) doConnect(connFactory func() (net.Conn, error)) (net.Conn, error) {
@@ -111,24 +201,81 @@ func (c *Client) Connected() bool {
 	return c.connected
 }
 
-func (c *Client) doPostConnect(nick, pass string, conn net.Conn, maxMessages, perSeconds float64) error {
+func (c *Client) doPostConnect(nick, pass string, conn net.Conn) error {
 	c.conn = conn
 	c.reader = bufio.NewReader(conn)
 	c.writer = bufio.NewWriter(conn)
 	c.doneChan = make(chan struct{})
-	c.sendQueue = make(chan string, sendBufferSize)
-	defer close(c.sendQueue)
+	c.pongQueue = make(chan outboundMessage, pongBufferSize)
+	c.cmdQueue = make(chan outboundMessage, sendBufferSize)
+	c.privmsgQueue = make(chan outboundMessage, sendBufferSize)
+	defer func() {
+		close(c.pongQueue)
+		close(c.cmdQueue)
+		close(c.privmsgQueue)
+	}()
 
 	if err := c.authenticate(nick, pass); err != nil {
 		return err
 	}
 
 	for _, channel := range c.options.Channels {
-		c.Join(channel)
+		if !strings.HasPrefix(channel, "#") {
+			channel = "#" + channel
+		}
+		c.joinedChannels.Store(channel, true)
+	}
+	// Options.Channels only seeds the first connection; reconnects restore
+	// from joinedChannels, so a channel parted since then stays parted.
+	c.options.Channels = nil
+
+	c.joinedChannels.Range(func(channel, _ interface{}) bool {
+		c.sendJoin(channel.(string))
+		return true
+	})
+
+	c.doConnectCallbacks()
+
+	go c.startSendLoop()
+	err := c.startRecvLoop()
+	c.doDisconnectCallbacks(err)
+	return err
+}
+
+// OnConnect adds an event callback that fires once authentication is done and
+// the initial channel joins have been queued, on every (re)connect.
+func (c *Client) OnConnect(callback func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.connectCallbacks = append(c.connectCallbacks, callback)
+}
+
+// OnDisconnect adds an event callback that fires when the connection is
+// lost, whether due to a network error or a call to Disconnect.
+func (c *Client) OnDisconnect(callback func(err error)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.disconnectCallbacks = append(c.disconnectCallbacks, callback)
+}
+
+func (c *Client) doConnectCallbacks() {
+	c.callbackMu.Lock()
+	callbacks := c.connectCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb()
 	}
+}
 
-	go c.startSendLoop(maxMessages, perSeconds)
-	return c.startRecvLoop()
+func (c *Client) doDisconnectCallbacks(err error) {
+	c.callbackMu.Lock()
+	callbacks := c.disconnectCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(err)
+	}
 }
 
 // Say sends a message to a channel
@@ -136,12 +283,12 @@ func (c *Client) Say(channel string, msg string) {
 	if channel[0] != '#' {
 		channel = "#" + channel
 	}
-	c.send(fmt.Sprintf("PRIVMSG %s :%s", channel, msg))
+	c.sendPrivmsg(channel, fmt.Sprintf("PRIVMSG %s :%s", channel, msg))
 }
 
 // Whisper sends a whisper to a user
 func (c *Client) Whisper(user string, msg string) {
-	c.Say("#jtv", "/w "+user+" "+msg)
+	c.sendWhisper(fmt.Sprintf("PRIVMSG #jtv :/w %s %s", user, msg))
 }
 
 // OnAction adds an event callback for action (e.g., /me) messages
@@ -232,7 +379,8 @@ func (c *Client) Join(channel string) {
 	if !strings.HasPrefix(channel, "#") {
 		channel = "#" + channel
 	}
-	c.send("JOIN %s", channel)
+	c.joinedChannels.Store(channel, true)
+	c.sendJoin(channel)
 }
 
 // Part tells the client to part a particular channel. If the "#" prefix is missing,
@@ -241,10 +389,90 @@ func (c *Client) Part(channel string) {
 	if !strings.HasPrefix(channel, "#") {
 		channel = "#" + channel
 	}
-	c.send("PART %s", channel)
+	c.joinedChannels.Delete(channel)
+	c.sendCommand("PART %s", channel)
+}
+
+// OnCap adds an event callback for when a capability is enabled or disabled,
+// either during the initial CAP negotiation or later via CAP NEW/CAP DEL.
+func (c *Client) OnCap(callback func(name string, enabled bool)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.capCallbacks = append(c.capCallbacks, callback)
+}
+
+// Caps returns the capabilities currently enabled on the connection, keyed by
+// name with their advertised value (if any).
+func (c *Client) Caps() map[string]string {
+	c.capsMu.RLock()
+	defer c.capsMu.RUnlock()
+
+	caps := make(map[string]string, len(c.caps))
+	for k, v := range c.caps {
+		caps[k] = v
+	}
+	return caps
+}
+
+func (c *Client) setCap(name, value string, enabled bool) {
+	c.capsMu.Lock()
+	if enabled {
+		c.caps[name] = value
+	} else {
+		delete(c.caps, name)
+	}
+	c.capsMu.Unlock()
+
+	c.doCapCallbacks(name, enabled)
+}
+
+func (c *Client) doCapCallbacks(name string, enabled bool) {
+	c.callbackMu.Lock()
+	callbacks := c.capCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(name, enabled)
+	}
 }
 
 func (c *Client) authenticate(nick, pass string) error {
+	// Caps from a previous connection no longer apply after a reconnect.
+	c.capsMu.Lock()
+	c.caps = make(map[string]string)
+	c.capsMu.Unlock()
+
+	if err := c.write("CAP LS 302\r\n"); err != nil {
+		return err
+	}
+
+	advertised, err := c.readCapLS()
+	if err != nil {
+		return err
+	}
+
+	requested := c.options.Capabilities
+	if len(requested) == 0 {
+		requested = defaultCapabilities
+	}
+
+	if err := c.requestCaps(advertised, requested); err != nil {
+		return err
+	}
+
+	if c.options.SASL != nil {
+		if _, ok := advertised["sasl"]; !ok {
+			return errors.New("server does not advertise the sasl capability")
+		}
+		if err := c.doSASL(c.options.SASL); err != nil {
+			return err
+		}
+	}
+
+	if err := c.write("CAP END\r\n"); err != nil {
+		return err
+	}
+
 	if err := c.write(fmt.Sprintf("PASS %s\r\nNICK %s\r\n", pass, nick)); err != nil {
 		return err
 	}
@@ -261,24 +489,161 @@ func (c *Client) authenticate(nick, pass string) error {
 		return fmt.Errorf("Unexpected server response: %s", line)
 	}
 
-	err = c.write(fmt.Sprintf("CAP REQ :%s\r\n", strings.Join(caps, " twitch.tv/")))
-	if err != nil {
+	return nil
+}
+
+// readCapLS reads and parses the (possibly multi-line) CAP * LS 302 response,
+// returning the server's advertised capabilities and their values.
+func (c *Client) readCapLS() (map[string]string, error) {
+	advertised := make(map[string]string)
+
+	for {
+		line, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+
+		msg := NewMessage(line)
+		if msg.Command != "CAP" || len(msg.Params) < 3 || msg.Params[1] != "LS" {
+			c.doCallbacks(line)
+			continue
+		}
+
+		more := msg.Params[2] == "*"
+		list := msg.Params[len(msg.Params)-1]
+
+		for _, entry := range strings.Fields(list) {
+			name, value := entry, ""
+			if idx := strings.IndexByte(entry, '='); idx >= 0 {
+				name, value = entry[:idx], entry[idx+1:]
+			}
+			advertised[name] = value
+		}
+
+		if !more {
+			return advertised, nil
+		}
+	}
+}
+
+// requestCaps sends CAP REQ for the requested capabilities that the server
+// advertised and waits for the server's ACK/NAK.
+func (c *Client) requestCaps(advertised map[string]string, requested []string) error {
+	var toRequest []string
+	for _, name := range requested {
+		if _, ok := advertised[name]; ok {
+			toRequest = append(toRequest, name)
+		}
+	}
+	if c.options.SASL != nil {
+		if _, ok := advertised["sasl"]; ok {
+			toRequest = append(toRequest, "sasl")
+		}
+	}
+
+	if len(toRequest) == 0 {
+		return nil
+	}
+
+	if err := c.write(fmt.Sprintf("CAP REQ :%s\r\n", strings.Join(toRequest, " "))); err != nil {
 		return err
 	}
 
-	return nil
+	for {
+		line, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		msg := NewMessage(line)
+		if msg.Command != "CAP" || len(msg.Params) < 3 {
+			c.doCallbacks(line)
+			continue
+		}
+
+		switch msg.Params[1] {
+		case "ACK":
+			for _, name := range strings.Fields(msg.Params[2]) {
+				c.setCap(name, advertised[name], true)
+			}
+			return nil
+		case "NAK":
+			return fmt.Errorf("server rejected capabilities: %s", msg.Params[2])
+		default:
+			c.doCallbacks(line)
+		}
+	}
 }
 
-func (c *Client) send(format string, args ...interface{}) {
-	if !c.Connected() {
-		return
+// doSASL drives the AUTHENTICATE handshake for the given mechanism, like
+// readCapLS/requestCaps it forwards any unrelated line (a NOTICE, a stray
+// PING) to doCallbacks and keeps waiting for the reply it needs.
+func (c *Client) doSASL(mech SASLMechanism) error {
+	if err := c.write(fmt.Sprintf("AUTHENTICATE %s\r\n", mech.Name())); err != nil {
+		return err
 	}
 
-	msg := fmt.Sprintf(format, args...)
-	select {
-	case c.sendQueue <- msg:
-	default:
-		c.log("Send queue full; discarding message: %s", msg)
+	for {
+		line, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		msg := NewMessage(line)
+		if msg.Command != "AUTHENTICATE" || len(msg.Params) == 0 || msg.Params[0] != "+" {
+			c.doCallbacks(line)
+			continue
+		}
+		break
+	}
+
+	if err := c.sendSASLResponse(mech.Response()); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		msg := NewMessage(line)
+		switch msg.Command {
+		case "903":
+			return nil
+		case "904", "905":
+			return fmt.Errorf("SASL authentication failed: %s", line)
+		default:
+			c.doCallbacks(line)
+		}
+	}
+}
+
+// sendSASLResponse base64-encodes payload and sends it in 400-byte
+// AUTHENTICATE chunks, per the IRCv3 SASL specification. An empty final
+// chunk (either because payload is empty, or its encoding is an exact
+// multiple of the chunk size) is sent as "AUTHENTICATE +".
+func (c *Client) sendSASLResponse(payload []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	for {
+		chunk := encoded
+		if len(chunk) > saslChunkSize {
+			chunk = chunk[:saslChunkSize]
+		}
+		encoded = encoded[len(chunk):]
+
+		data := chunk
+		if data == "" {
+			data = "+"
+		}
+		if err := c.write(fmt.Sprintf("AUTHENTICATE %s\r\n", data)); err != nil {
+			return err
+		}
+
+		if len(chunk) < saslChunkSize {
+			return nil
+		}
 	}
 }
 
@@ -304,43 +669,6 @@ func (c *Client) log(format string, v ...interface{}) {
 	}
 }
 
-func (c *Client) startSendLoop(maxMessages, perSeconds float64) {
-	defer c.conn.Close()
-	tokens := maxMessages
-	lastTick := time.Now()
-
-	for {
-		select {
-		case <-c.doneChan:
-			return
-		case data := <-c.sendQueue:
-			if !strings.HasSuffix(data, "\r\n") {
-				data = data + "\r\n"
-			}
-
-			now := time.Now()
-			elapsedTime := now.Sub(lastTick)
-			lastTick = now
-			tokens += elapsedTime.Seconds() * (maxMessages / perSeconds)
-
-			if tokens >= maxMessages {
-				tokens = maxMessages
-			} else if tokens < 1 {
-				required := 1 - tokens
-				time.Sleep(time.Duration(required * float64(time.Second)))
-			}
-
-			if err := c.write(data); err != nil {
-				c.log("ERROR sending: %s", err)
-				c.Disconnect()
-				return
-			}
-
-			tokens--
-		}
-	}
-}
-
 func (c *Client) startRecvLoop() error {
 	for {
 		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
@@ -357,6 +685,10 @@ func (c *Client) startRecvLoop() error {
 func (c *Client) doCallbacks(line string) {
 	msg := NewMessage(line)
 
+	if c.doRawMessageCallbacks(&msg) {
+		return
+	}
+
 	switch msg.Command {
 	case "PRIVMSG":
 		var m string
@@ -370,6 +702,7 @@ func (c *Client) doCallbacks(line string) {
 		} else {
 			if _, cheered := msg.Tags["bits"]; cheered {
 				c.doCheerCallbacks(&msg)
+				c.doCheerEventCallbacks(&msg)
 			} else {
 				c.doChatCallbacks(&msg)
 			}
@@ -397,14 +730,19 @@ func (c *Client) doCallbacks(line string) {
 		break
 
 	case "USERNOTICE":
-		msgid := msg.Tags["msg-id"]
-		if msgid == "resub" {
-			c.doResubCallbacks(&msg)
-		} else if msgid == "sub" {
-			c.doSubscriptionCallbacks(&msg)
-		} else if msgid == "subgift" {
-			c.doSubGiftCallbacks(&msg)
-		}
+		c.doUserNoticeCallbacks(&msg)
+		break
+
+	case "CLEARCHAT":
+		c.doClearChatCallbacks(&msg)
+		break
+
+	case "CLEARMSG":
+		c.doClearMsgCallbacks(&msg)
+		break
+
+	case "HOSTTARGET":
+		c.doHostTargetCallbacks(&msg)
 		break
 
 	case "WHISPER":
@@ -412,14 +750,31 @@ func (c *Client) doCallbacks(line string) {
 		break
 
 	case "PING":
-		c.send(fmt.Sprintf("PONG :%s", msg.Params[0]))
+		c.sendPong(fmt.Sprintf("PONG :%s", msg.Params[0]))
+		break
+
+	case "CAP":
+		c.doCapNotify(&msg)
+		break
+
+	case "GLOBALUSERSTATE":
+		c.doGlobalUserStateCallbacks(&msg)
 		break
 
+	case "RECONNECT":
+		c.doReconnectRequestedCallbacks(&msg)
+		break
+
+	default:
+		c.doUnhandledCallbacks(&msg)
+
 	}
 
 }
 
 func (c *Client) doUserStateCallbacks(msg *Message) {
+	c.maybeUpgradeChannelLimit(msg.Params[0], msg.Tags)
+
 	c.callbackMu.Lock()
 	callbacks := c.userStateCallbacks
 	c.callbackMu.Unlock()
@@ -0,0 +1,135 @@
+package gotirc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Dialer establishes the underlying network connection Connect
+// authenticates over, letting callers plug in alternate transports.
+type Dialer interface {
+	Dial(ctx context.Context) (net.Conn, error)
+}
+
+// TCPDialer dials a plain, unencrypted TCP connection. This is gotirc's
+// original (and default) transport.
+type TCPDialer struct {
+	Host string
+	Port int
+}
+
+// Dial connects to Host:Port over TCP.
+func (d TCPDialer) Dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", d.Host, d.Port))
+}
+
+// TLSDialer dials a TLS-wrapped TCP connection, e.g. Twitch's
+// irc.chat.twitch.tv:6697. A nil Config uses sane defaults.
+type TLSDialer struct {
+	Host   string
+	Port   int
+	Config *tls.Config
+}
+
+// Dial connects to Host:Port over TLS.
+func (d TLSDialer) Dial(ctx context.Context) (net.Conn, error) {
+	dialer := tls.Dialer{Config: d.Config}
+	return dialer.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", d.Host, d.Port))
+}
+
+// WSDialer dials Twitch's WebSocket IRC gateway (irc-ws.chat.twitch.tv:443),
+// for deployments where a raw TCP socket isn't available, e.g. sandboxed or
+// browser-proxied environments behind a corporate proxy.
+type WSDialer struct {
+	URL string
+}
+
+// Dial connects to URL over WebSocket and adapts it into a line-oriented
+// net.Conn.
+func (d WSDialer) Dial(ctx context.Context) (net.Conn, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, d.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{ws: ws}, nil
+}
+
+// wsConn adapts a *websocket.Conn -- which sends and receives whole IRC
+// lines as discrete text frames -- into the line-oriented net.Conn that
+// bufio.Reader.ReadString('\n') expects.
+type wsConn struct {
+	ws  *websocket.Conn
+	buf []byte
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	if len(c.buf) == 0 {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			data = append(data, '\r', '\n')
+		}
+		c.buf = data
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte("\r\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if err := c.ws.WriteMessage(websocket.TextMessage, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error                       { return c.ws.Close() }
+func (c *wsConn) LocalAddr() net.Addr                { return c.ws.LocalAddr() }
+func (c *wsConn) RemoteAddr() net.Addr               { return c.ws.RemoteAddr() }
+func (c *wsConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// NewTLSOptions returns Options configured to connect to Twitch's TLS IRC
+// endpoint (irc.chat.twitch.tv:6697) instead of the default plaintext port.
+func NewTLSOptions() Options {
+	host := "irc.chat.twitch.tv"
+	port := 6697
+	return Options{
+		Host:   host,
+		Port:   port,
+		Dialer: TLSDialer{Host: host, Port: port},
+	}
+}
+
+// NewWebSocketOptions returns Options configured to connect to Twitch over
+// its WebSocket IRC gateway, for deployments where a raw TCP socket isn't
+// available.
+func NewWebSocketOptions() Options {
+	return Options{
+		Host:   "irc-ws.chat.twitch.tv",
+		Port:   443,
+		Dialer: WSDialer{URL: "wss://irc-ws.chat.twitch.tv:443"},
+	}
+}
@@ -0,0 +1,548 @@
+package gotirc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Badge is a single entry from a user's "badges" tag, e.g. {"subscriber", "12"}
+// for a 12-month subscriber badge.
+type Badge struct {
+	Name    string
+	Version string
+}
+
+// EmoteRange is a single emote occurrence from a message's "emotes" tag,
+// giving the emote ID and the (inclusive) byte range it occupies in the
+// message text.
+type EmoteRange struct {
+	ID    string
+	Start int
+	End   int
+}
+
+// SubEvent describes a new subscription (USERNOTICE msg-id=sub).
+type SubEvent struct {
+	Channel     string
+	User        string
+	DisplayName string
+	Tier        string
+	TierName    string
+	Months      int
+	Message     string
+	Badges      []Badge
+}
+
+// ResubEvent describes a subscription renewal (USERNOTICE msg-id=resub).
+type ResubEvent struct {
+	Channel           string
+	User              string
+	DisplayName       string
+	Tier              string
+	TierName          string
+	Months            int
+	StreakMonths      int
+	ShouldShareStreak bool
+	Message           string
+	Badges            []Badge
+	Emotes            []EmoteRange
+}
+
+// SubGiftEvent describes a single gifted subscription (USERNOTICE msg-id=subgift).
+type SubGiftEvent struct {
+	Channel    string
+	Gifter     string
+	Recipient  string
+	Tier       string
+	TierName   string
+	Months     int
+	GiftMonths int
+	Badges     []Badge
+}
+
+// SubMysteryGiftEvent describes a batch of gifted subscriptions (USERNOTICE
+// msg-id=submysterygift); a SubGiftEvent follows for each recipient.
+type SubMysteryGiftEvent struct {
+	Channel     string
+	Gifter      string
+	Tier        string
+	Count       int
+	SenderTotal int
+}
+
+// RaidEvent describes an incoming raid (USERNOTICE msg-id=raid).
+type RaidEvent struct {
+	Channel     string
+	FromChannel string
+	Viewers     int
+}
+
+// RitualEvent describes a channel ritual, e.g. "new_chatter" (USERNOTICE
+// msg-id=ritual).
+type RitualEvent struct {
+	Channel string
+	User    string
+	Ritual  string
+	Message string
+}
+
+// BitsBadgeTierEvent fires when a user unlocks a new bits badge tier
+// (USERNOTICE msg-id=bitsbadgetier).
+type BitsBadgeTierEvent struct {
+	Channel string
+	User    string
+	Tier    int
+}
+
+// CheerEvent describes a PRIVMSG carrying a "bits" tag.
+type CheerEvent struct {
+	Channel string
+	User    string
+	Bits    int
+	Message string
+	Badges  []Badge
+	Emotes  []EmoteRange
+}
+
+// BanEvent describes a permanent ban (CLEARCHAT with no ban-duration tag).
+type BanEvent struct {
+	Channel string
+	User    string
+}
+
+// TimeoutEvent describes a temporary ban (CLEARCHAT with a ban-duration tag).
+type TimeoutEvent struct {
+	Channel  string
+	User     string
+	Duration time.Duration
+}
+
+// MessageDeletedEvent describes a single deleted message (CLEARMSG).
+type MessageDeletedEvent struct {
+	Channel     string
+	User        string
+	Message     string
+	TargetMsgID string
+}
+
+// HostEvent describes a host starting or stopping (HOSTTARGET). Target is
+// empty when the channel stopped hosting.
+type HostEvent struct {
+	Channel string
+	Target  string
+	Viewers int
+}
+
+func parseBadges(tags map[string]string) []Badge {
+	raw := tags["badges"]
+	if raw == "" {
+		return nil
+	}
+
+	var badges []Badge
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.SplitN(entry, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		badges = append(badges, Badge{Name: parts[0], Version: parts[1]})
+	}
+	return badges
+}
+
+func parseEmotes(tags map[string]string) []EmoteRange {
+	raw := tags["emotes"]
+	if raw == "" {
+		return nil
+	}
+
+	var emotes []EmoteRange
+	for _, group := range strings.Split(raw, "/") {
+		idRanges := strings.SplitN(group, ":", 2)
+		if len(idRanges) != 2 {
+			continue
+		}
+
+		for _, r := range strings.Split(idRanges[1], ",") {
+			bounds := strings.SplitN(r, "-", 2)
+			if len(bounds) != 2 {
+				continue
+			}
+			start, startErr := strconv.Atoi(bounds[0])
+			end, endErr := strconv.Atoi(bounds[1])
+			if startErr != nil || endErr != nil {
+				continue
+			}
+			emotes = append(emotes, EmoteRange{ID: idRanges[0], Start: start, End: end})
+		}
+	}
+	return emotes
+}
+
+func tagInt(tags map[string]string, key string) int {
+	v, err := strconv.Atoi(tags[key])
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func userNoticeUser(msg *Message) string {
+	if login := msg.Tags["login"]; login != "" {
+		return login
+	}
+	return msg.Prefix.Nick
+}
+
+func userNoticeMessage(msg *Message) string {
+	if len(msg.Params) > 1 {
+		return msg.Params[1]
+	}
+	return ""
+}
+
+// OnSubEvent adds an event callback for new subscriptions, parsed from USERNOTICE.
+func (c *Client) OnSubEvent(callback func(event SubEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.subEventCallbacks = append(c.subEventCallbacks, callback)
+}
+
+// OnResubEvent adds an event callback for subscription renewals, parsed from USERNOTICE.
+func (c *Client) OnResubEvent(callback func(event ResubEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.resubEventCallbacks = append(c.resubEventCallbacks, callback)
+}
+
+// OnSubGiftEvent adds an event callback for gifted subscriptions, parsed from USERNOTICE.
+func (c *Client) OnSubGiftEvent(callback func(event SubGiftEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.subGiftEventCallbacks = append(c.subGiftEventCallbacks, callback)
+}
+
+// OnSubMysteryGift adds an event callback for batches of gifted subscriptions.
+func (c *Client) OnSubMysteryGift(callback func(event SubMysteryGiftEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.subMysteryGiftCallbacks = append(c.subMysteryGiftCallbacks, callback)
+}
+
+// OnCheerEvent adds an event callback for cheers, parsed from PRIVMSG.
+func (c *Client) OnCheerEvent(callback func(event CheerEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.cheerEventCallbacks = append(c.cheerEventCallbacks, callback)
+}
+
+// OnRaid adds an event callback for incoming raids.
+func (c *Client) OnRaid(callback func(event RaidEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.raidCallbacks = append(c.raidCallbacks, callback)
+}
+
+// OnRitual adds an event callback for channel rituals (e.g. new_chatter).
+func (c *Client) OnRitual(callback func(event RitualEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.ritualCallbacks = append(c.ritualCallbacks, callback)
+}
+
+// OnBitsBadgeTier adds an event callback for newly unlocked bits badge tiers.
+func (c *Client) OnBitsBadgeTier(callback func(event BitsBadgeTierEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.bitsBadgeTierCallbacks = append(c.bitsBadgeTierCallbacks, callback)
+}
+
+// OnBan adds an event callback for permanent bans, parsed from CLEARCHAT.
+func (c *Client) OnBan(callback func(event BanEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.banCallbacks = append(c.banCallbacks, callback)
+}
+
+// OnTimeout adds an event callback for temporary bans, parsed from CLEARCHAT.
+func (c *Client) OnTimeout(callback func(event TimeoutEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.timeoutCallbacks = append(c.timeoutCallbacks, callback)
+}
+
+// OnMessageDeleted adds an event callback for single deleted messages, parsed from CLEARMSG.
+func (c *Client) OnMessageDeleted(callback func(event MessageDeletedEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.messageDeletedCallbacks = append(c.messageDeletedCallbacks, callback)
+}
+
+// OnHost adds an event callback for HOSTTARGET, fired when this channel
+// starts or stops hosting another channel.
+func (c *Client) OnHost(callback func(event HostEvent)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.hostCallbacks = append(c.hostCallbacks, callback)
+}
+
+func (c *Client) doUserNoticeCallbacks(msg *Message) {
+	switch msg.Tags["msg-id"] {
+	case "resub":
+		c.doResubCallbacks(msg)
+		c.doResubEventCallbacks(msg)
+	case "sub":
+		c.doSubscriptionCallbacks(msg)
+		c.doSubEventCallbacks(msg)
+	case "subgift":
+		c.doSubGiftCallbacks(msg)
+		c.doSubGiftEventCallbacks(msg)
+	case "submysterygift":
+		c.doSubMysteryGiftCallbacks(msg)
+	case "raid":
+		c.doRaidCallbacks(msg)
+	case "ritual":
+		c.doRitualCallbacks(msg)
+	case "bitsbadgetier":
+		c.doBitsBadgeTierCallbacks(msg)
+	}
+}
+
+func (c *Client) doSubEventCallbacks(msg *Message) {
+	event := SubEvent{
+		Channel:     msg.Params[0],
+		User:        userNoticeUser(msg),
+		DisplayName: msg.Tags["display-name"],
+		Tier:        msg.Tags["msg-param-sub-plan"],
+		TierName:    msg.Tags["msg-param-sub-plan-name"],
+		Months:      tagInt(msg.Tags, "msg-param-cumulative-months"),
+		Message:     userNoticeMessage(msg),
+		Badges:      parseBadges(msg.Tags),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.subEventCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doResubEventCallbacks(msg *Message) {
+	event := ResubEvent{
+		Channel:           msg.Params[0],
+		User:              userNoticeUser(msg),
+		DisplayName:       msg.Tags["display-name"],
+		Tier:              msg.Tags["msg-param-sub-plan"],
+		TierName:          msg.Tags["msg-param-sub-plan-name"],
+		Months:            tagInt(msg.Tags, "msg-param-cumulative-months"),
+		StreakMonths:      tagInt(msg.Tags, "msg-param-streak-months"),
+		ShouldShareStreak: msg.Tags["msg-param-should-share-streak"] == "1",
+		Message:           userNoticeMessage(msg),
+		Badges:            parseBadges(msg.Tags),
+		Emotes:            parseEmotes(msg.Tags),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.resubEventCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doSubGiftEventCallbacks(msg *Message) {
+	event := SubGiftEvent{
+		Channel:    msg.Params[0],
+		Gifter:     userNoticeUser(msg),
+		Recipient:  msg.Tags["msg-param-recipient-user-name"],
+		Tier:       msg.Tags["msg-param-sub-plan"],
+		TierName:   msg.Tags["msg-param-sub-plan-name"],
+		Months:     tagInt(msg.Tags, "msg-param-months"),
+		GiftMonths: tagInt(msg.Tags, "msg-param-gift-months"),
+		Badges:     parseBadges(msg.Tags),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.subGiftEventCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doSubMysteryGiftCallbacks(msg *Message) {
+	event := SubMysteryGiftEvent{
+		Channel:     msg.Params[0],
+		Gifter:      userNoticeUser(msg),
+		Tier:        msg.Tags["msg-param-sub-plan"],
+		Count:       tagInt(msg.Tags, "msg-param-mass-gift-count"),
+		SenderTotal: tagInt(msg.Tags, "msg-param-sender-count"),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.subMysteryGiftCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doRaidCallbacks(msg *Message) {
+	event := RaidEvent{
+		Channel:     msg.Params[0],
+		FromChannel: msg.Tags["msg-param-login"],
+		Viewers:     tagInt(msg.Tags, "msg-param-viewerCount"),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.raidCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doRitualCallbacks(msg *Message) {
+	event := RitualEvent{
+		Channel: msg.Params[0],
+		User:    userNoticeUser(msg),
+		Ritual:  msg.Tags["msg-param-ritual-name"],
+		Message: userNoticeMessage(msg),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.ritualCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doBitsBadgeTierCallbacks(msg *Message) {
+	event := BitsBadgeTierEvent{
+		Channel: msg.Params[0],
+		User:    userNoticeUser(msg),
+		Tier:    tagInt(msg.Tags, "msg-param-threshold"),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.bitsBadgeTierCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doCheerEventCallbacks(msg *Message) {
+	event := CheerEvent{
+		Channel: msg.Params[0],
+		User:    msg.Prefix.Nick,
+		Bits:    tagInt(msg.Tags, "bits"),
+		Message: msg.Params[1],
+		Badges:  parseBadges(msg.Tags),
+		Emotes:  parseEmotes(msg.Tags),
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.cheerEventCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doClearChatCallbacks(msg *Message) {
+	if len(msg.Params) < 2 {
+		return
+	}
+
+	channel, user := msg.Params[0], msg.Params[1]
+
+	if durationStr, ok := msg.Tags["ban-duration"]; ok {
+		seconds, err := strconv.Atoi(durationStr)
+		if err != nil {
+			return
+		}
+
+		event := TimeoutEvent{Channel: channel, User: user, Duration: time.Duration(seconds) * time.Second}
+
+		c.callbackMu.Lock()
+		callbacks := c.timeoutCallbacks
+		c.callbackMu.Unlock()
+
+		for _, cb := range callbacks {
+			cb(event)
+		}
+		return
+	}
+
+	event := BanEvent{Channel: channel, User: user}
+
+	c.callbackMu.Lock()
+	callbacks := c.banCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doClearMsgCallbacks(msg *Message) {
+	if len(msg.Params) < 1 {
+		return
+	}
+
+	event := MessageDeletedEvent{
+		Channel:     msg.Params[0],
+		User:        msg.Tags["login"],
+		Message:     userNoticeMessage(msg),
+		TargetMsgID: msg.Tags["target-msg-id"],
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.messageDeletedCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
+
+func (c *Client) doHostTargetCallbacks(msg *Message) {
+	if len(msg.Params) < 2 {
+		return
+	}
+
+	fields := strings.Fields(msg.Params[1])
+	if len(fields) == 0 {
+		return
+	}
+
+	event := HostEvent{Channel: msg.Params[0]}
+	if fields[0] != "-" {
+		event.Target = fields[0]
+	}
+	if len(fields) > 1 {
+		if viewers, err := strconv.Atoi(fields[1]); err == nil {
+			event.Viewers = viewers
+		}
+	}
+
+	c.callbackMu.Lock()
+	callbacks := c.hostCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(event)
+	}
+}
@@ -0,0 +1,83 @@
+package gotirc
+
+// OnRawMessage adds a middleware callback that runs before any built-in
+// dispatch, for every parsed message. If callback returns true, the message
+// is considered handled and gotirc's own dispatch (and any OnUnhandled
+// callbacks) is skipped for it. Callbacks run in registration order; the
+// first to return true wins.
+func (c *Client) OnRawMessage(callback func(msg Message) (handled bool)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.rawMessageCallbacks = append(c.rawMessageCallbacks, callback)
+}
+
+// OnUnhandled adds an event callback for any command gotirc has no built-in
+// dispatch for (and that no OnRawMessage callback claimed).
+func (c *Client) OnUnhandled(callback func(msg Message)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.unhandledCallbacks = append(c.unhandledCallbacks, callback)
+}
+
+// OnGlobalUserState adds an event callback for GLOBALUSERSTATE, sent once
+// after successful authentication with the account's global badges/emote-sets.
+func (c *Client) OnGlobalUserState(callback func(tags map[string]string)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.globalUserStateCallbacks = append(c.globalUserStateCallbacks, callback)
+}
+
+// OnReconnectRequested adds an event callback for Twitch's RECONNECT
+// command, sent shortly before the server closes the connection for
+// maintenance. Clients using Run will reconnect automatically regardless;
+// this callback exists so callers using Connect directly can react too.
+func (c *Client) OnReconnectRequested(callback func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.reconnectRequestedCallbacks = append(c.reconnectRequestedCallbacks, callback)
+}
+
+// doRawMessageCallbacks runs the OnRawMessage middleware chain, returning
+// true if a callback claimed the message.
+func (c *Client) doRawMessageCallbacks(msg *Message) bool {
+	c.callbackMu.Lock()
+	callbacks := c.rawMessageCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		if cb(*msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) doUnhandledCallbacks(msg *Message) {
+	c.callbackMu.Lock()
+	callbacks := c.unhandledCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(*msg)
+	}
+}
+
+func (c *Client) doGlobalUserStateCallbacks(msg *Message) {
+	c.callbackMu.Lock()
+	callbacks := c.globalUserStateCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(msg.Tags)
+	}
+}
+
+func (c *Client) doReconnectRequestedCallbacks(msg *Message) {
+	c.callbackMu.Lock()
+	callbacks := c.reconnectRequestedCallbacks
+	c.callbackMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb()
+	}
+}
@@ -0,0 +1,449 @@
+package gotirc
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultMaxChannelsPerConn = 90
+
+const ringVirtualNodes = 64
+
+// ConnStats reports the load on a single connection within a Pool.
+type ConnStats struct {
+	Index      int
+	Channels   int
+	QueueDepth int
+}
+
+type ringPoint struct {
+	hash  uint32
+	index int
+}
+
+// Pool wraps multiple Client connections and distributes channels across
+// them using consistent hashing, so that joining more channels than a
+// single connection can hold (Twitch caps both the JOIN rate and the
+// channel count per connection) transparently spins up additional
+// connections.
+type Pool struct {
+	mu      sync.Mutex
+	nick    string
+	pass    string
+	options Options
+
+	maxChannelsPerConn int
+
+	ctx     context.Context
+	started bool
+
+	clients       []*Client
+	channelCounts []int
+	channelOwner  map[string]int
+	ring          []ringPoint
+
+	registrations []func(*Client)
+
+	// runWg and runErrs track every client's Run goroutine, including ones
+	// started after Run by a concurrent Join, so Run's WaitGroup can't
+	// return before a shard it spun up later has finished.
+	runWg   sync.WaitGroup
+	errMu   sync.Mutex
+	runErrs []error
+}
+
+// NewPool returns a Pool that will authenticate each underlying connection
+// with nick/pass, using o as a template for every Client it creates
+// (o.Channels is ignored; join channels via Pool.Join).
+func NewPool(nick, pass string, o Options) *Pool {
+	maxChannels := o.MaxChannelsPerConn
+	if maxChannels <= 0 {
+		maxChannels = defaultMaxChannelsPerConn
+	}
+
+	return &Pool{
+		nick:               nick,
+		pass:               pass,
+		options:            o,
+		maxChannelsPerConn: maxChannels,
+		channelOwner:       make(map[string]int),
+	}
+}
+
+// Run starts every connection in the pool (creating one if none exist yet)
+// and blocks until ctx is cancelled or every connection's Run returns,
+// including connections started later by a concurrent Join.
+func (p *Pool) Run(ctx context.Context) error {
+	p.mu.Lock()
+	p.ctx = ctx
+	p.started = true
+	if len(p.clients) == 0 {
+		p.addClientLocked()
+	} else {
+		for _, client := range p.clients {
+			p.startClientLocked(client)
+		}
+	}
+	p.mu.Unlock()
+
+	p.runWg.Wait()
+
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if len(p.runErrs) > 0 {
+		return p.runErrs[0]
+	}
+	return nil
+}
+
+// startClientLocked starts client's Run loop and records it against runWg/
+// runErrs, so Run's wait and returned error account for it. Caller must
+// hold p.mu.
+func (p *Pool) startClientLocked(client *Client) {
+	p.runWg.Add(1)
+	go func() {
+		defer p.runWg.Done()
+		if err := client.Run(p.ctx, p.nick, p.pass); err != nil {
+			p.errMu.Lock()
+			p.runErrs = append(p.runErrs, err)
+			p.errMu.Unlock()
+		}
+	}()
+}
+
+// Join assigns channel to a connection via consistent hashing and joins it.
+// If every connection the hash could route to is already at
+// Options.MaxChannelsPerConn, a new connection is started.
+func (p *Pool) Join(channel string) {
+	if !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+
+	p.mu.Lock()
+	if idx, ok := p.channelOwner[channel]; ok {
+		client := p.clients[idx]
+		p.mu.Unlock()
+		client.Join(channel)
+		return
+	}
+
+	idx, ok := p.ringLookupLocked(channel)
+	if !ok {
+		idx = p.addClientLocked()
+	}
+
+	p.channelOwner[channel] = idx
+	p.channelCounts[idx]++
+	client := p.clients[idx]
+	p.mu.Unlock()
+
+	client.Join(channel)
+}
+
+// Part leaves channel and frees its slot on whichever connection owned it.
+func (p *Pool) Part(channel string) {
+	if !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+
+	p.mu.Lock()
+	idx, ok := p.channelOwner[channel]
+	if ok {
+		delete(p.channelOwner, channel)
+		p.channelCounts[idx]--
+	}
+	p.mu.Unlock()
+
+	if ok {
+		p.clients[idx].Part(channel)
+	}
+}
+
+// Say sends msg to channel via the connection that owns it.
+func (p *Pool) Say(channel, msg string) {
+	if !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+
+	if client, ok := p.ownerFor(channel); ok {
+		client.Say(channel, msg)
+	}
+}
+
+// Whisper sends a whisper via the connection assigned to user by consistent
+// hashing, spreading whisper traffic across the pool.
+func (p *Pool) Whisper(user, msg string) {
+	p.mu.Lock()
+	if len(p.clients) == 0 {
+		p.addClientLocked()
+	}
+	idx, ok := p.ringLookupLocked(user)
+	if !ok {
+		idx = 0
+	}
+	client := p.clients[idx]
+	p.mu.Unlock()
+
+	client.Whisper(user, msg)
+}
+
+// Stats reports the channel count and send-queue depth of every connection
+// in the pool, in the order the connections were created.
+func (p *Pool) Stats() []ConnStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]ConnStats, len(p.clients))
+	for i, client := range p.clients {
+		stats[i] = ConnStats{
+			Index:      i,
+			Channels:   p.channelCounts[i],
+			QueueDepth: client.QueueDepth(),
+		}
+	}
+	return stats
+}
+
+// ownerFor returns the channel's assigned connection, falling back to a
+// consistent-hash lookup (without assigning ownership) if it hasn't been
+// joined through this Pool.
+func (p *Pool) ownerFor(channel string) (*Client, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idx, ok := p.channelOwner[channel]; ok {
+		return p.clients[idx], true
+	}
+
+	if idx, ok := p.ringLookupLocked(channel); ok {
+		return p.clients[idx], true
+	}
+
+	return nil, false
+}
+
+// addClientLocked creates a new Client, wires up every callback previously
+// registered on the pool, and (if the pool has already been started)
+// starts it running. Caller must hold p.mu.
+func (p *Pool) addClientLocked() int {
+	opts := p.options
+	opts.Channels = nil
+	client := NewClient(opts)
+
+	for _, register := range p.registrations {
+		register(client)
+	}
+
+	idx := len(p.clients)
+	p.clients = append(p.clients, client)
+	p.channelCounts = append(p.channelCounts, 0)
+	p.addRingNodesLocked(idx)
+
+	if p.started {
+		p.startClientLocked(client)
+	}
+
+	return idx
+}
+
+func (p *Pool) addRingNodesLocked(idx int) {
+	for v := 0; v < ringVirtualNodes; v++ {
+		hash := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d-%d", idx, v)))
+		p.ring = append(p.ring, ringPoint{hash: hash, index: idx})
+	}
+
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+}
+
+// ringLookupLocked walks the hash ring clockwise from key's hash, returning
+// the first connection that isn't at MaxChannelsPerConn. Caller must hold p.mu.
+func (p *Pool) ringLookupLocked(key string) (int, bool) {
+	n := len(p.ring)
+	if n == 0 {
+		return 0, false
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(n, func(i int) bool { return p.ring[i].hash >= hash })
+
+	for i := 0; i < n; i++ {
+		point := p.ring[(start+i)%n]
+		if p.channelCounts[point.index] < p.maxChannelsPerConn {
+			return point.index, true
+		}
+	}
+
+	return 0, false
+}
+
+// registerOn records reg so it applies to every future connection, and
+// applies it to every connection that already exists.
+func (p *Pool) registerOn(reg func(*Client)) {
+	p.mu.Lock()
+	p.registrations = append(p.registrations, reg)
+	clients := append([]*Client(nil), p.clients...)
+	p.mu.Unlock()
+
+	for _, client := range clients {
+		reg(client)
+	}
+}
+
+// OnAction fans out to every connection in the pool. See Client.OnAction.
+func (p *Pool) OnAction(callback func(channel string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnAction(callback) })
+}
+
+// OnUserState fans out to every connection in the pool. See Client.OnUserState.
+func (p *Pool) OnUserState(callback func(channel string, tags map[string]string)) {
+	p.registerOn(func(c *Client) { c.OnUserState(callback) })
+}
+
+// OnRoomState fans out to every connection in the pool. See Client.OnRoomState.
+func (p *Pool) OnRoomState(callback func(channel string, tags map[string]string)) {
+	p.registerOn(func(c *Client) { c.OnRoomState(callback) })
+}
+
+// OnNotice fans out to every connection in the pool. See Client.OnNotice.
+func (p *Pool) OnNotice(callback func(msg string)) {
+	p.registerOn(func(c *Client) { c.OnNotice(callback) })
+}
+
+// OnChat fans out to every connection in the pool. See Client.OnChat.
+func (p *Pool) OnChat(callback func(channel string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnChat(callback) })
+}
+
+// OnResub fans out to every connection in the pool. See Client.OnResub.
+func (p *Pool) OnResub(callback func(channel string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnResub(callback) })
+}
+
+// OnSubscription fans out to every connection in the pool. See Client.OnSubscription.
+func (p *Pool) OnSubscription(callback func(channel string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnSubscription(callback) })
+}
+
+// OnSubGift fans out to every connection in the pool. See Client.OnSubGift.
+func (p *Pool) OnSubGift(callback func(channel string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnSubGift(callback) })
+}
+
+// OnCheer fans out to every connection in the pool. See Client.OnCheer.
+func (p *Pool) OnCheer(callback func(channel string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnCheer(callback) })
+}
+
+// OnJoin fans out to every connection in the pool. See Client.OnJoin.
+func (p *Pool) OnJoin(callback func(channel, username string)) {
+	p.registerOn(func(c *Client) { c.OnJoin(callback) })
+}
+
+// OnPart fans out to every connection in the pool. See Client.OnPart.
+func (p *Pool) OnPart(callback func(channel, username string)) {
+	p.registerOn(func(c *Client) { c.OnPart(callback) })
+}
+
+// OnWhisper fans out to every connection in the pool. See Client.OnWhisper.
+func (p *Pool) OnWhisper(callback func(username string, tags map[string]string, msg string)) {
+	p.registerOn(func(c *Client) { c.OnWhisper(callback) })
+}
+
+// OnCap fans out to every connection in the pool. See Client.OnCap.
+func (p *Pool) OnCap(callback func(name string, enabled bool)) {
+	p.registerOn(func(c *Client) { c.OnCap(callback) })
+}
+
+// OnConnect fans out to every connection in the pool. See Client.OnConnect.
+func (p *Pool) OnConnect(callback func()) {
+	p.registerOn(func(c *Client) { c.OnConnect(callback) })
+}
+
+// OnDisconnect fans out to every connection in the pool. See Client.OnDisconnect.
+func (p *Pool) OnDisconnect(callback func(err error)) {
+	p.registerOn(func(c *Client) { c.OnDisconnect(callback) })
+}
+
+// OnSubEvent fans out to every connection in the pool. See Client.OnSubEvent.
+func (p *Pool) OnSubEvent(callback func(event SubEvent)) {
+	p.registerOn(func(c *Client) { c.OnSubEvent(callback) })
+}
+
+// OnResubEvent fans out to every connection in the pool. See Client.OnResubEvent.
+func (p *Pool) OnResubEvent(callback func(event ResubEvent)) {
+	p.registerOn(func(c *Client) { c.OnResubEvent(callback) })
+}
+
+// OnSubGiftEvent fans out to every connection in the pool. See Client.OnSubGiftEvent.
+func (p *Pool) OnSubGiftEvent(callback func(event SubGiftEvent)) {
+	p.registerOn(func(c *Client) { c.OnSubGiftEvent(callback) })
+}
+
+// OnSubMysteryGift fans out to every connection in the pool. See Client.OnSubMysteryGift.
+func (p *Pool) OnSubMysteryGift(callback func(event SubMysteryGiftEvent)) {
+	p.registerOn(func(c *Client) { c.OnSubMysteryGift(callback) })
+}
+
+// OnCheerEvent fans out to every connection in the pool. See Client.OnCheerEvent.
+func (p *Pool) OnCheerEvent(callback func(event CheerEvent)) {
+	p.registerOn(func(c *Client) { c.OnCheerEvent(callback) })
+}
+
+// OnRaid fans out to every connection in the pool. See Client.OnRaid.
+func (p *Pool) OnRaid(callback func(event RaidEvent)) {
+	p.registerOn(func(c *Client) { c.OnRaid(callback) })
+}
+
+// OnRitual fans out to every connection in the pool. See Client.OnRitual.
+func (p *Pool) OnRitual(callback func(event RitualEvent)) {
+	p.registerOn(func(c *Client) { c.OnRitual(callback) })
+}
+
+// OnBitsBadgeTier fans out to every connection in the pool. See Client.OnBitsBadgeTier.
+func (p *Pool) OnBitsBadgeTier(callback func(event BitsBadgeTierEvent)) {
+	p.registerOn(func(c *Client) { c.OnBitsBadgeTier(callback) })
+}
+
+// OnBan fans out to every connection in the pool. See Client.OnBan.
+func (p *Pool) OnBan(callback func(event BanEvent)) {
+	p.registerOn(func(c *Client) { c.OnBan(callback) })
+}
+
+// OnTimeout fans out to every connection in the pool. See Client.OnTimeout.
+func (p *Pool) OnTimeout(callback func(event TimeoutEvent)) {
+	p.registerOn(func(c *Client) { c.OnTimeout(callback) })
+}
+
+// OnMessageDeleted fans out to every connection in the pool. See Client.OnMessageDeleted.
+func (p *Pool) OnMessageDeleted(callback func(event MessageDeletedEvent)) {
+	p.registerOn(func(c *Client) { c.OnMessageDeleted(callback) })
+}
+
+// OnHost fans out to every connection in the pool. See Client.OnHost.
+func (p *Pool) OnHost(callback func(event HostEvent)) {
+	p.registerOn(func(c *Client) { c.OnHost(callback) })
+}
+
+// OnRawMessage fans out to every connection in the pool. See Client.OnRawMessage.
+func (p *Pool) OnRawMessage(callback func(msg Message) (handled bool)) {
+	p.registerOn(func(c *Client) { c.OnRawMessage(callback) })
+}
+
+// OnUnhandled fans out to every connection in the pool. See Client.OnUnhandled.
+func (p *Pool) OnUnhandled(callback func(msg Message)) {
+	p.registerOn(func(c *Client) { c.OnUnhandled(callback) })
+}
+
+// OnGlobalUserState fans out to every connection in the pool. See Client.OnGlobalUserState.
+func (p *Pool) OnGlobalUserState(callback func(tags map[string]string)) {
+	p.registerOn(func(c *Client) { c.OnGlobalUserState(callback) })
+}
+
+// OnReconnectRequested fans out to every connection in the pool. See Client.OnReconnectRequested.
+func (p *Pool) OnReconnectRequested(callback func()) {
+	p.registerOn(func(c *Client) { c.OnReconnectRequested(callback) })
+}
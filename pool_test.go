@@ -0,0 +1,59 @@
+package gotirc
+
+import "testing"
+
+func TestPoolJoinSpillsToNewConnectionWhenFull(t *testing.T) {
+	p := NewPool("nick", "pass", Options{MaxChannelsPerConn: 1})
+
+	p.Join("#a")
+	p.Join("#b")
+	p.Join("#c")
+
+	if len(p.clients) != 3 {
+		t.Fatalf("expected 3 connections once each hit MaxChannelsPerConn=1, got %d", len(p.clients))
+	}
+
+	owners := make(map[int]bool)
+	for _, channel := range []string{"#a", "#b", "#c"} {
+		idx, ok := p.channelOwner[channel]
+		if !ok {
+			t.Fatalf("%s was never assigned an owner", channel)
+		}
+		owners[idx] = true
+	}
+	if len(owners) != 3 {
+		t.Fatalf("expected each channel on its own connection, got %d distinct owners", len(owners))
+	}
+}
+
+func TestPoolRingLookupRespectsCapacity(t *testing.T) {
+	p := NewPool("nick", "pass", Options{MaxChannelsPerConn: 2})
+
+	p.mu.Lock()
+	first := p.addClientLocked()
+	second := p.addClientLocked()
+	p.channelCounts[first] = 2 // at capacity
+	idx, ok := p.ringLookupLocked("#somechannel")
+	p.mu.Unlock()
+
+	if !ok {
+		t.Fatal("expected ringLookupLocked to find the connection with spare capacity")
+	}
+	if idx != second {
+		t.Fatalf("expected lookup to skip the full connection %d and return %d, got %d", first, second, idx)
+	}
+}
+
+func TestPoolRingLookupFailsWhenEveryConnectionIsFull(t *testing.T) {
+	p := NewPool("nick", "pass", Options{MaxChannelsPerConn: 1})
+
+	p.mu.Lock()
+	idx := p.addClientLocked()
+	p.channelCounts[idx] = 1
+	_, ok := p.ringLookupLocked("#somechannel")
+	p.mu.Unlock()
+
+	if ok {
+		t.Fatal("expected ringLookupLocked to report no capacity when every connection is full")
+	}
+}
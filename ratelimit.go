@@ -0,0 +1,375 @@
+package gotirc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pongBufferSize is small since PONGs are never expected to queue up; a full
+// pong lane would mean the connection is already in serious trouble.
+const pongBufferSize = 8
+
+// RateLimitKind identifies which of Twitch's independent rate limits a
+// token bucket governs.
+type RateLimitKind int
+
+const (
+	rateLimitNone RateLimitKind = iota
+
+	// RatePrivmsg governs PRIVMSG sends, with per-channel overrides applied
+	// automatically when USERSTATE indicates elevated privileges.
+	RatePrivmsg
+
+	// RateJoin governs the JOIN command, which Twitch limits globally
+	// regardless of channel.
+	RateJoin
+
+	// RateWhisper governs outgoing whispers.
+	RateWhisper
+)
+
+// sendPriority orders the lanes serviced by startSendLoop.
+type sendPriority int
+
+const (
+	priorityPong sendPriority = iota
+	priorityCommand
+	priorityPrivmsg
+)
+
+// outboundMessage is a single line queued for the send loop.
+type outboundMessage struct {
+	priority sendPriority
+	kind     RateLimitKind
+	channel  string
+	line     string
+
+	// done, if set, receives the result of the write (or an error if the
+	// client disconnects before it could be sent) instead of the message
+	// being silently discarded on a full queue.
+	done chan error
+}
+
+// tokenBucket is a simple token-bucket rate limiter: rate tokens are
+// available per `per` seconds, refilled continuously.
+type tokenBucket struct {
+	mu         sync.Mutex
+	capacity   float64
+	perSecond  float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rate, per float64) *tokenBucket {
+	return &tokenBucket{
+		capacity:   rate,
+		perSecond:  rate / per,
+		tokens:     rate,
+		lastRefill: time.Now(),
+	}
+}
+
+func (b *tokenBucket) setRate(rate, per float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.capacity = rate
+	b.perSecond = rate / per
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+func (b *tokenBucket) refillLocked() {
+	now := time.Now()
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+	b.tokens += elapsed * b.perSecond
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// tryTake attempts to take one token. If unavailable, it returns the
+// duration the caller should wait before trying again.
+func (b *tokenBucket) tryTake() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refillLocked()
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / b.perSecond * float64(time.Second))
+}
+
+// SetRateLimit configures the token-bucket rate used for the given kind of
+// outgoing message, e.g. SetRateLimit(RatePrivmsg, 100, 30) for a moderator
+// account's 100 messages per 30 seconds allowance.
+func (c *Client) SetRateLimit(kind RateLimitKind, rate, per float64) {
+	c.rateLimitMu.Lock()
+	bucket, ok := c.rateLimits[kind]
+	if !ok {
+		bucket = newTokenBucket(rate, per)
+		c.rateLimits[kind] = bucket
+	}
+	c.rateLimitMu.Unlock()
+
+	bucket.setRate(rate, per)
+}
+
+// maybeUpgradeChannelLimit upgrades a channel's PRIVMSG rate limit to the
+// moderator/VIP tier the first time USERSTATE reports elevated privileges
+// in that channel.
+func (c *Client) maybeUpgradeChannelLimit(channel string, tags map[string]string) {
+	if !isElevated(tags) {
+		return
+	}
+
+	c.channelLimitMu.Lock()
+	defer c.channelLimitMu.Unlock()
+	if _, ok := c.channelLimits[channel]; ok {
+		return
+	}
+	c.channelLimits[channel] = newTokenBucket(100, 30)
+}
+
+func isElevated(tags map[string]string) bool {
+	if tags["mod"] == "1" {
+		return true
+	}
+
+	for _, badge := range strings.Split(tags["badges"], ",") {
+		if strings.HasPrefix(badge, "broadcaster/") || strings.HasPrefix(badge, "moderator/") || strings.HasPrefix(badge, "vip/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bucketFor returns the token bucket governing kind, preferring a
+// per-channel override for RatePrivmsg when one exists. Returns nil for
+// rateLimitNone, meaning the message is never rate limited.
+func (c *Client) bucketFor(kind RateLimitKind, channel string) *tokenBucket {
+	if kind == rateLimitNone {
+		return nil
+	}
+
+	if kind == RatePrivmsg && channel != "" {
+		c.channelLimitMu.Lock()
+		bucket, ok := c.channelLimits[channel]
+		c.channelLimitMu.Unlock()
+		if ok {
+			return bucket
+		}
+	}
+
+	c.rateLimitMu.RLock()
+	defer c.rateLimitMu.RUnlock()
+	return c.rateLimits[kind]
+}
+
+func (c *Client) sendPong(line string) {
+	c.enqueue(outboundMessage{priority: priorityPong, line: line})
+}
+
+func (c *Client) sendCommand(format string, args ...interface{}) {
+	c.enqueue(outboundMessage{priority: priorityCommand, line: fmt.Sprintf(format, args...)})
+}
+
+func (c *Client) sendJoin(channel string) {
+	c.enqueue(outboundMessage{priority: priorityCommand, kind: RateJoin, line: fmt.Sprintf("JOIN %s", channel)})
+}
+
+func (c *Client) sendPrivmsg(channel, line string) {
+	c.enqueue(outboundMessage{priority: priorityPrivmsg, kind: RatePrivmsg, channel: channel, line: line})
+}
+
+func (c *Client) sendWhisper(line string) {
+	c.enqueue(outboundMessage{priority: priorityPrivmsg, kind: RateWhisper, channel: "#jtv", line: line})
+}
+
+// enqueue drops m when its lane is full, the same "don't block the caller"
+// behavior gotirc has always had for fire-and-forget sends.
+func (c *Client) enqueue(m outboundMessage) {
+	if !c.Connected() {
+		return
+	}
+
+	select {
+	case c.queueFor(m.priority) <- m:
+	default:
+		c.log("Send queue full; discarding message: %s", m.line)
+	}
+}
+
+func (c *Client) queueFor(priority sendPriority) chan outboundMessage {
+	switch priority {
+	case priorityPong:
+		return c.pongQueue
+	case priorityCommand:
+		return c.cmdQueue
+	default:
+		return c.privmsgQueue
+	}
+}
+
+// SendBlocking sends a PRIVMSG to channel like Say, but waits for a send-queue
+// slot and a rate-limit token instead of discarding the message when the
+// queue is full. It returns when the message has actually been written, or
+// if ctx is cancelled or the client disconnects first.
+func (c *Client) SendBlocking(ctx context.Context, channel, msg string) error {
+	if !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+
+	if !c.Connected() {
+		return errors.New("not connected")
+	}
+
+	done := make(chan error, 1)
+	m := outboundMessage{
+		priority: priorityPrivmsg,
+		kind:     RatePrivmsg,
+		channel:  channel,
+		line:     fmt.Sprintf("PRIVMSG %s :%s", channel, msg),
+		done:     done,
+	}
+
+	select {
+	case c.privmsgQueue <- m:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.doneChan:
+		return errors.New("disconnected")
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.doneChan:
+		return errors.New("disconnected")
+	}
+}
+
+// QueueDepth returns the number of messages currently buffered across all
+// send lanes, for monitoring (see Pool.Stats).
+func (c *Client) QueueDepth() int {
+	return len(c.pongQueue) + len(c.cmdQueue) + len(c.privmsgQueue)
+}
+
+func (c *Client) startSendLoop() {
+	defer c.conn.Close()
+	defer c.drainSendQueues()
+
+	for {
+		select {
+		case <-c.doneChan:
+			return
+		case m := <-c.pongQueue:
+			c.dispatch(m)
+			continue
+		default:
+		}
+
+		select {
+		case <-c.doneChan:
+			return
+		case m := <-c.pongQueue:
+			c.dispatch(m)
+			continue
+		case m := <-c.cmdQueue:
+			c.dispatch(m)
+			continue
+		default:
+		}
+
+		select {
+		case <-c.doneChan:
+			return
+		case m := <-c.pongQueue:
+			c.dispatch(m)
+		case m := <-c.cmdQueue:
+			c.dispatch(m)
+		case m := <-c.privmsgQueue:
+			c.dispatch(m)
+		}
+	}
+}
+
+// drainSendQueues fails any already-queued SendBlocking calls with a
+// "disconnected" error instead of leaving their done channel (and the
+// goroutine waiting on it) hanging forever once startSendLoop stops
+// servicing the queues.
+func (c *Client) drainSendQueues() {
+	for _, q := range []chan outboundMessage{c.pongQueue, c.cmdQueue, c.privmsgQueue} {
+	drain:
+		for {
+			select {
+			case m := <-q:
+				if m.done != nil {
+					m.done <- errors.New("disconnected")
+					close(m.done)
+				}
+			default:
+				break drain
+			}
+		}
+	}
+}
+
+func (c *Client) dispatch(m outboundMessage) {
+	if bucket := c.bucketFor(m.kind, m.channel); bucket != nil {
+		if !c.waitForToken(bucket) {
+			if m.done != nil {
+				m.done <- errors.New("disconnected")
+				close(m.done)
+			}
+			return
+		}
+	}
+
+	line := m.line
+	if !strings.HasSuffix(line, "\r\n") {
+		line += "\r\n"
+	}
+
+	err := c.write(line)
+	if m.done != nil {
+		m.done <- err
+		close(m.done)
+	}
+
+	if err != nil {
+		c.log("ERROR sending: %s", err)
+		c.Disconnect()
+	}
+}
+
+// waitForToken blocks until bucket has a token available, servicing any
+// PONGs that arrive in the meantime so heartbeats are never stalled behind
+// a rate-limited chat queue. Returns false if the client disconnects first.
+func (c *Client) waitForToken(bucket *tokenBucket) bool {
+	for {
+		ok, wait := bucket.tryTake()
+		if ok {
+			return true
+		}
+
+		select {
+		case <-c.doneChan:
+			return false
+		case m := <-c.pongQueue:
+			c.dispatch(m)
+		case <-time.After(wait):
+		}
+	}
+}
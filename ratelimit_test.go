@@ -0,0 +1,45 @@
+package gotirc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTakesUpToCapacity(t *testing.T) {
+	b := newTokenBucket(2, 1) // 2 tokens/sec, capacity 2
+
+	for i := 0; i < 2; i++ {
+		ok, _ := b.tryTake()
+		if !ok {
+			t.Fatalf("take %d: expected a token to be available", i)
+		}
+	}
+
+	ok, wait := b.tryTake()
+	if ok {
+		t.Fatal("expected bucket to be empty")
+	}
+	if wait <= 0 {
+		t.Fatalf("expected a positive wait, got %v", wait)
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	b := newTokenBucket(10, 1) // 10 tokens/sec
+	b.tokens = 0
+	b.lastRefill = time.Now().Add(-200 * time.Millisecond)
+
+	ok, _ := b.tryTake()
+	if !ok {
+		t.Fatal("expected a token to have refilled after 200ms at 10/sec")
+	}
+}
+
+func TestTokenBucketSetRateClampsExistingTokens(t *testing.T) {
+	b := newTokenBucket(10, 1)
+	b.setRate(3, 1)
+
+	if b.tokens != 3 {
+		t.Fatalf("expected tokens clamped to new capacity 3, got %v", b.tokens)
+	}
+}
@@ -0,0 +1,107 @@
+package gotirc
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy configures the backoff used by Client.Run when the
+// connection drops.
+type ReconnectPolicy struct {
+	// Disabled opts out of reconnection, so Run behaves like a single call
+	// to Connect. Left unset (the zero value), reconnection is on, so that
+	// a caller who only sets e.g. MaxAttempts still gets the default
+	// backoff timing instead of losing reconnection entirely.
+	Disabled bool
+
+	// InitialBackoff is the delay before the first reconnect attempt. Zero
+	// uses DefaultReconnectPolicy's 1s.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between reconnect attempts. Zero uses
+	// DefaultReconnectPolicy's 60s.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction (0-1) of randomness applied to each backoff,
+	// e.g. 0.2 means +/-20%. Zero uses DefaultReconnectPolicy's 0.2.
+	Jitter float64
+
+	// MaxAttempts caps the number of reconnect attempts. 0 means unlimited.
+	MaxAttempts int
+}
+
+// DefaultReconnectPolicy returns the backoff gotirc uses when Run is called
+// with a zero-value ReconnectPolicy: 1s doubling up to 60s, +/-20% jitter,
+// retried indefinitely.
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     60 * time.Second,
+		Jitter:         0.2,
+	}
+}
+
+// Run behaves like Connect, except that on disconnection (read/write errors,
+// a dropped PING, or the server closing the connection) it automatically
+// reconnects using the client's ReconnectPolicy, re-authenticating,
+// re-negotiating capabilities, and re-joining every channel the client had
+// joined. Run blocks until ctx is cancelled or the reconnect attempt budget
+// is exhausted, at which point it returns the last connection error.
+func (c *Client) Run(ctx context.Context, nick, pass string) error {
+	policy := c.options.ReconnectPolicy
+	if policy.InitialBackoff == 0 {
+		policy.InitialBackoff = DefaultReconnectPolicy().InitialBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = DefaultReconnectPolicy().MaxBackoff
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = DefaultReconnectPolicy().Jitter
+	}
+
+	var attempt int
+	for {
+		err := c.connect(ctx, nick, pass)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if policy.Disabled {
+			return err
+		}
+
+		attempt++
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			return err
+		}
+
+		c.log("Reconnecting (attempt %d) after error: %v", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectBackoff(policy, attempt)):
+		}
+	}
+}
+
+// reconnectBackoff computes the delay before the given (1-indexed) reconnect
+// attempt: InitialBackoff doubled per attempt, capped at MaxBackoff, with
+// +/-Jitter fraction of randomness applied.
+func reconnectBackoff(policy ReconnectPolicy, attempt int) time.Duration {
+	backoff := policy.InitialBackoff << uint(attempt-1)
+	if backoff <= 0 || backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		delta := float64(backoff) * policy.Jitter
+		backoff += time.Duration((rand.Float64()*2 - 1) * delta)
+		if backoff < 0 {
+			backoff = 0
+		}
+	}
+
+	return backoff
+}
@@ -0,0 +1,86 @@
+package gotirc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failDialer always fails to dial, so Run never gets past the reconnect loop.
+type failDialer struct {
+	attempts *int32
+}
+
+func (d failDialer) Dial(ctx context.Context) (net.Conn, error) {
+	atomic.AddInt32(d.attempts, 1)
+	return nil, errors.New("dial refused")
+}
+
+func TestRunKeepsMaxAttemptsWithoutExplicitlyEnabling(t *testing.T) {
+	var attempts int32
+	c := NewClient(Options{
+		Dialer:          failDialer{attempts: &attempts},
+		ReconnectPolicy: ReconnectPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+
+	if err := c.Run(context.Background(), "nick", "pass"); err == nil {
+		t.Fatal("expected Run to return the last dial error")
+	}
+
+	if attempts != 2 {
+		t.Fatalf("expected the initial attempt plus 1 retry (MaxAttempts: 1), got %d attempts", attempts)
+	}
+}
+
+func TestRunHonorsExplicitDisabled(t *testing.T) {
+	var attempts int32
+	c := NewClient(Options{
+		Dialer:          failDialer{attempts: &attempts},
+		ReconnectPolicy: ReconnectPolicy{Disabled: true},
+	})
+
+	if err := c.Run(context.Background(), "nick", "pass"); err == nil {
+		t.Fatal("expected Run to return the dial error")
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected Disabled to stop after the first attempt, got %d attempts", attempts)
+	}
+}
+
+func TestReconnectBackoffDoublesUpToMax(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialBackoff: 1_000_000_000, // 1s, expressed in ns
+		MaxBackoff:     8_000_000_000, // 8s
+		Jitter:         0,
+	}
+
+	want := []int64{1, 2, 4, 8, 8, 8}
+	for i, w := range want {
+		got := reconnectBackoff(policy, i+1)
+		if got.Seconds() != float64(w) {
+			t.Errorf("attempt %d: got %v, want %ds", i+1, got, w)
+		}
+	}
+}
+
+func TestReconnectBackoffJitterStaysInBounds(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialBackoff: 1_000_000_000,
+		MaxBackoff:     60_000_000_000,
+		Jitter:         0.2,
+	}
+
+	for i := 0; i < 100; i++ {
+		backoff := reconnectBackoff(policy, 3) // base: 4s
+		if backoff < 0 {
+			t.Fatalf("negative backoff: %v", backoff)
+		}
+		if backoff.Seconds() < 3.2 || backoff.Seconds() > 4.8 {
+			t.Fatalf("backoff %v outside +/-20%% of 4s", backoff)
+		}
+	}
+}